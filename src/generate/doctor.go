@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"models"
+)
+
+const doctorTimeout = 5 * time.Second
+
+// doctorCheck is one row of the doctor report. Result is PASS, FAIL or SKIP
+// for checks that cannot be performed, which do not fail the doctor.
+type doctorCheck struct {
+	Name     string
+	Endpoint string
+	Result   string
+	Detail   string
+}
+
+// runDoctor probes the endpoints args and manifest resolve to, using the
+// certificates extracted into outputDir, and prints a report to out. It
+// returns false when any check failed.
+func runDoctor(args models.InstallerArguments, manifest models.Manifest, outputDir string, out io.Writer) bool {
+	var checks []doctorCheck
+	tlsCheck := func(name, endpoint, caFile, certFile, keyFile, serverName string) {
+		checks = append(checks, probeTLS(name, endpoint, outputDir, caFile, certFile, keyFile, serverName))
+	}
+
+	if !args.BoshDNS {
+		serfLan, server, httpPort, httpsPort := 8301, 8300, 8500, 8543
+		if ports := consulPorts(manifest); ports != nil {
+			for _, port := range []struct {
+				value   *int
+				setting *int
+			}{
+				{ports.SerfLan, &serfLan},
+				{ports.Server, &server},
+				{ports.HTTP, &httpPort},
+				{ports.HTTPS, &httpsPort},
+			} {
+				if port.value != nil {
+					*port.setting = *port.value
+				}
+			}
+		}
+
+		for _, ip := range strings.Split(args.ConsulIPs, ",") {
+			checks = append(checks,
+				probeTCP("consul serf LAN", net.JoinHostPort(ip, strconv.Itoa(serfLan))),
+				probeTCP("consul server RPC", net.JoinHostPort(ip, strconv.Itoa(server))))
+
+			if args.ConsulRequireSSL {
+				serverName := "server." + consulDatacenter(manifest) + "." + args.ConsulDomain
+				checks = append(checks, probeConsulAPI(net.JoinHostPort(ip, strconv.Itoa(httpsPort)), outputDir, serverName))
+			} else {
+				checks = append(checks, probeConsulAPI(net.JoinHostPort(ip, strconv.Itoa(httpPort)), "", ""))
+			}
+		}
+	}
+
+	for _, machine := range etcdMachines(args) {
+		u, err := url.Parse(machine)
+		if err != nil {
+			checks = append(checks, doctorCheck{"etcd", machine, "FAIL", err.Error()})
+			continue
+		}
+		if u.Scheme == "https" {
+			tlsCheck("etcd", u.Host, "etcd_ca.crt", "etcd_client.crt", "etcd_client.key", "")
+		} else {
+			checks = append(checks, probeTCP("etcd", u.Host))
+		}
+	}
+
+	bbsAddress := args.BbsAddress
+	if bbsAddress == "" {
+		bbsAddress, _ = diegoAddresses(manifest, args.ConsulDomain)
+	}
+	if args.BbsRequireSsl {
+		tlsCheck("BBS", bbsAddress, "bbs_ca.crt", "bbs_client.crt", "bbs_client.key", "")
+	} else {
+		checks = append(checks, probeTCP("BBS", bbsAddress))
+	}
+
+	for _, server := range syslogServers(args) {
+		host, transport, port, err := parseSyslogServer(server)
+		if err != nil {
+			checks = append(checks, doctorCheck{"syslog", server, "FAIL", err.Error()})
+			continue
+		}
+		endpoint := net.JoinHostPort(host, strconv.Itoa(port))
+
+		switch {
+		case transport == "udp":
+			checks = append(checks, doctorCheck{"syslog", endpoint, "SKIP", "udp cannot be probed"})
+		case args.SyslogTLS:
+			caFile := ""
+			if args.SyslogCA {
+				caFile = "syslog_ca.crt"
+			}
+			// rsyslog checks the server against the permitted peer
+			serverName := ""
+			if !strings.Contains(args.SyslogPermittedPeer, "*") {
+				serverName = args.SyslogPermittedPeer
+			}
+			tlsCheck("syslog", endpoint, caFile, "", "", serverName)
+		default:
+			checks = append(checks, probeTCP("syslog", endpoint))
+		}
+	}
+
+	writer := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "CHECK\tENDPOINT\tRESULT\tDETAIL\n")
+	failed := 0
+	for _, check := range checks {
+		if check.Result == "FAIL" {
+			failed++
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", check.Name, check.Endpoint, check.Result, check.Detail)
+	}
+	writer.Flush()
+
+	if failed > 0 {
+		fmt.Fprintf(out, "\n%d of %d checks failed\n", failed, len(checks))
+		return false
+	}
+	return true
+}
+
+func consulDatacenter(manifest models.Manifest) string {
+	properties := firstRepJob(manifest).Properties
+	if properties.Consul == nil {
+		properties = manifest.Properties
+	}
+	if properties != nil && properties.Consul != nil && properties.Consul.Agent.Datacenter != "" {
+		return properties.Consul.Agent.Datacenter
+	}
+	return "dc1"
+}
+
+func probeTCP(name, endpoint string) doctorCheck {
+	conn, err := net.DialTimeout("tcp", endpoint, doctorTimeout)
+	if err != nil {
+		return doctorCheck{name, endpoint, "FAIL", err.Error()}
+	}
+	conn.Close()
+	return doctorCheck{name, endpoint, "PASS", "TCP connect"}
+}
+
+// probeTLS performs a TLS handshake with endpoint. The CA and the client
+// certificate are read from the files extracted into outputDir, and the
+// server name defaults to the host of the endpoint.
+func probeTLS(name, endpoint, outputDir, caFile, certFile, keyFile, serverName string) doctorCheck {
+	config, err := doctorTLSConfig(outputDir, caFile, certFile, keyFile)
+	if err != nil {
+		return doctorCheck{name, endpoint, "FAIL", err.Error()}
+	}
+	config.ServerName = serverName
+	if config.ServerName == "" {
+		config.ServerName, _, _ = net.SplitHostPort(endpoint)
+	}
+
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: doctorTimeout}, "tcp", endpoint, config)
+	if err != nil {
+		return doctorCheck{name, endpoint, "FAIL", err.Error()}
+	}
+	conn.Close()
+	return doctorCheck{name, endpoint, "PASS", "TLS handshake"}
+}
+
+func doctorTLSConfig(outputDir, caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if caFile != "" {
+		ca, err := ioutil.ReadFile(path.Join(outputDir, caFile))
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("%s does not contain a PEM certificate", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(path.Join(outputDir, certFile), path.Join(outputDir, keyFile))
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// probeConsulAPI asks a consul server for the cluster leader. Servers
+// usually only serve their HTTP API locally, so an unreachable API is
+// skipped rather than failed. The API is queried over HTTPS with the consul
+// agent certificate when serverName is given.
+func probeConsulAPI(endpoint, outputDir, serverName string) doctorCheck {
+	conn, err := net.DialTimeout("tcp", endpoint, doctorTimeout)
+	if err != nil {
+		return doctorCheck{"consul HTTP API", endpoint, "SKIP", "not reachable"}
+	}
+	conn.Close()
+
+	scheme := "http"
+	transport := &http.Transport{}
+	if serverName != "" {
+		config, err := doctorTLSConfig(outputDir, "consul_ca.crt", "consul_agent.crt", "consul_agent.key")
+		if err != nil {
+			return doctorCheck{"consul HTTP API", endpoint, "FAIL", err.Error()}
+		}
+		config.ServerName = serverName
+		transport.TLSClientConfig = config
+		scheme = "https"
+	}
+
+	client := &http.Client{Transport: transport, Timeout: doctorTimeout}
+	response, err := client.Get(scheme + "://" + endpoint + "/v1/status/leader")
+	if err != nil {
+		return doctorCheck{"consul HTTP API", endpoint, "FAIL", err.Error()}
+	}
+	defer response.Body.Close()
+
+	var leader string
+	if response.StatusCode != http.StatusOK || json.NewDecoder(response.Body).Decode(&leader) != nil {
+		return doctorCheck{"consul HTTP API", endpoint, "FAIL", "unexpected response " + response.Status}
+	}
+	if leader == "" {
+		return doctorCheck{"consul HTTP API", endpoint, "FAIL", "no cluster leader"}
+	}
+	return doctorCheck{"consul HTTP API", endpoint, "PASS", "leader " + leader}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"models"
+)
+
+// plainBatchValue matches values that mean the same to cmd.exe, msiexec and
+// the command line parsing of other programs without quoting.
+var plainBatchValue = regexp.MustCompile(`^[A-Za-z0-9._:/,=@+*$#~\\-]*$`)
+
+// scriptFuncs are the escaping functions available to the script templates.
+var scriptFuncs = template.FuncMap{
+	"bat":        batchValue,
+	"batQuoted":  quotedBatchValue,
+	"powershell": powershellValue,
+}
+
+// batchValue escapes a value for an install.bat command line, e.g. an msiexec
+// PROPERTY=value argument. Values with special characters are quoted, with
+// quotes doubled as msiexec expects. Percent signs are doubled since cmd.exe
+// expands variables even within quotes, the other special characters
+// (^ & | < > !) are literal within quotes as long as delayed expansion is
+// disabled.
+func batchValue(value string) (string, error) {
+	if plainBatchValue.MatchString(value) {
+		return value, nil
+	}
+	if err := checkScriptValue(value); err != nil {
+		return "", err
+	}
+
+	value = strings.Replace(value, "%", "%%", -1)
+	value = strings.Replace(value, `"`, `""`, -1)
+	return `"` + doubleTrailingBackslashes(value) + `"`, nil
+}
+
+// quotedBatchValue escapes a value for use within a double quoted argument
+// of a program that parses its command line like the C runtime, e.g. setx.
+// Those programs have no reliable way to escape a quote from cmd.exe, so
+// quotes are rejected.
+func quotedBatchValue(value string) (string, error) {
+	if err := checkScriptValue(value); err != nil {
+		return "", err
+	}
+	if strings.Contains(value, `"`) {
+		return "", fmt.Errorf("%q cannot contain double quotes", value)
+	}
+
+	value = strings.Replace(value, "%", "%%", -1)
+	return doubleTrailingBackslashes(value), nil
+}
+
+// powershellValue quotes a value as a PowerShell single quoted string, in
+// which nothing is expanded and single quotes, including the typographic
+// ones PowerShell accepts as well, are escaped by doubling them.
+func powershellValue(value string) (string, error) {
+	if err := checkScriptValue(value); err != nil {
+		return "", err
+	}
+
+	var quoted []rune
+	for _, r := range value {
+		switch r {
+		case '\'', '‘', '’', '‚', '‛':
+			quoted = append(quoted, r, r)
+		default:
+			quoted = append(quoted, r)
+		}
+	}
+	return "'" + string(quoted) + "'", nil
+}
+
+// doubleTrailingBackslashes keeps the backslashes at the end of a value from
+// escaping the closing quote.
+func doubleTrailingBackslashes(value string) string {
+	trimmed := strings.TrimRight(value, `\`)
+	return value + value[len(trimmed):]
+}
+
+// checkScriptValue rejects values no quoting can represent in a script line.
+func checkScriptValue(value string) error {
+	for _, r := range value {
+		if r < 0x20 || r == 0x7f {
+			return fmt.Errorf("%q contains a control character", value)
+		}
+	}
+	return nil
+}
+
+// checkBatchValue rejects values cmd.exe cannot read from install.bat, which
+// it decodes in the OEM code page rather than as UTF-8.
+func checkBatchValue(value string) error {
+	for _, r := range value {
+		if r > 0x7e {
+			return fmt.Errorf("%q contains non-ASCII characters, which install.bat cannot represent, use -format ps1", value)
+		}
+	}
+	return nil
+}
+
+// validateInstallerArguments checks that every string field of args can be
+// rendered into the scripts, so the operator learns which setting is wrong.
+// Values for install.bat are limited to ASCII when batch is set.
+func validateInstallerArguments(args models.InstallerArguments, batch bool) error {
+	value := reflect.ValueOf(args)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		var values []string
+		switch field.Kind() {
+		case reflect.String:
+			values = []string{field.String()}
+		case reflect.Slice:
+			if field.Type().Elem().Kind() == reflect.String {
+				values = field.Interface().([]string)
+			}
+		}
+
+		for _, v := range values {
+			err := checkScriptValue(v)
+			if err == nil && batch {
+				err = checkBatchValue(v)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid %s: %s", value.Type().Field(i).Name, err)
+			}
+		}
+	}
+	return nil
+}
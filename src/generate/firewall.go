@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"models"
+)
+
+const (
+	firewallBatTemplate = `{{ range . }}netsh advfirewall firewall delete rule name="{{batQuoted .Name}}" >nul
+netsh advfirewall firewall add rule name="{{batQuoted .Name}}" dir={{.Direction}} action=allow protocol={{.Protocol}} {{ if eq .Direction "in" }}localport{{ else }}remoteport{{ end }}={{.Port}}
+{{ end }}`
+
+	removeFirewallBatTemplate = `{{ range . }}netsh advfirewall firewall delete rule name="{{batQuoted .Name}}"
+{{ end }}`
+)
+
+// firewallRule allows the traffic of one port, protocol and direction.
+type firewallRule struct {
+	Name      string
+	Direction string
+	Protocol  string
+	Port      int
+}
+
+// newFirewallRule names the rule after its purpose, protocol, direction and
+// port. The scripts replace rules by name, so rules for different ports must
+// not share one.
+func newFirewallRule(purpose, direction, protocol string, port int) firewallRule {
+	protocol = strings.ToUpper(protocol)
+	return firewallRule{
+		Name:      fmt.Sprintf("Diego - %s (%s-%s %d)", purpose, protocol, strings.Title(direction), port),
+		Direction: direction,
+		Protocol:  protocol,
+		Port:      port,
+	}
+}
+
+// firewallRules returns the rules the cell needs for the ports of the
+// components configured in args and manifest: the consul agent or BOSH DNS,
+// metron, the rep, the BBS, locket, syslog and etcd.
+func firewallRules(args models.InstallerArguments, manifest models.Manifest) ([]firewallRule, error) {
+	var rules []firewallRule
+
+	if args.BoshDNS {
+		rules = append(rules,
+			newFirewallRule("DNS", "out", "udp", 53),
+			newFirewallRule("DNS", "out", "tcp", 53))
+	} else {
+		serfLan, server := 8301, 8300
+		if ports := consulPorts(manifest); ports != nil {
+			if ports.SerfLan != nil {
+				serfLan = *ports.SerfLan
+			}
+			if ports.Server != nil {
+				server = *ports.Server
+			}
+		}
+		for _, protocol := range []string{"tcp", "udp"} {
+			rules = append(rules,
+				newFirewallRule("Consul serf LAN", "in", protocol, serfLan),
+				newFirewallRule("Consul serf LAN", "out", protocol, serfLan))
+		}
+		rules = append(rules, newFirewallRule("Consul server RPC", "out", "tcp", server))
+	}
+
+	doppler := dopplerPorts(manifest)
+	protocols := []string{"udp"}
+	if args.MetronProtocols != "" {
+		protocols = strings.Split(args.MetronProtocols, ",")
+	} else if args.MetronPreferTLS {
+		protocols = []string{"tls"}
+	}
+	for _, protocol := range protocols {
+		transport := protocol
+		if protocol == "tls" {
+			transport = "tcp"
+		}
+		rules = append(rules, newFirewallRule("Metron to doppler "+strings.ToUpper(protocol), "out", transport, doppler[protocol]))
+	}
+	if args.LoggregatorV2 {
+		rules = append(rules, newFirewallRule("Metron to doppler gRPC", "out", "tcp", doppler["grpc"]))
+	}
+
+	repPort, err := repListenPort(manifest, args.RepRequireTLS)
+	if err != nil {
+		return nil, err
+	}
+	rules = append(rules, newFirewallRule("Rep", "in", "tcp", repPort))
+
+	bbsAddress, locketAddress := args.BbsAddress, args.LocketAddress
+	if !args.BoshDNS {
+		bbsAddress, locketAddress = diegoAddresses(manifest, args.ConsulDomain)
+	}
+	for _, service := range []struct {
+		name    string
+		address string
+	}{
+		{"BBS", bbsAddress},
+		{"Locket", locketAddress},
+	} {
+		_, port, err := net.SplitHostPort(service.address)
+		if err == nil {
+			var servicePort int
+			servicePort, err = strconv.Atoi(port)
+			if err == nil {
+				rules = append(rules, newFirewallRule(service.name, "out", "tcp", servicePort))
+				continue
+			}
+		}
+		return nil, fmt.Errorf("invalid %s address %q: %s", service.name, service.address, err)
+	}
+
+	for _, server := range syslogServers(args) {
+		host, transport, port, err := parseSyslogServer(server)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, newFirewallRule("Syslog to "+host, "out", transport, port))
+	}
+
+	for _, machine := range etcdMachines(args) {
+		u, err := url.Parse(machine)
+		if err != nil {
+			return nil, fmt.Errorf("invalid etcd machine %q: %s", machine, err)
+		}
+		_, port, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("invalid etcd machine %q: %s", machine, err)
+		}
+		etcdPort, err := strconv.Atoi(port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid etcd machine %q: %s", machine, err)
+		}
+		rules = append(rules, newFirewallRule("etcd", "out", "tcp", etcdPort))
+	}
+
+	return uniqueFirewallRules(rules), nil
+}
+
+func uniqueFirewallRules(rules []firewallRule) []firewallRule {
+	var unique []firewallRule
+	seen := map[firewallRule]bool{}
+	for _, rule := range rules {
+		if !seen[rule] {
+			seen[rule] = true
+			unique = append(unique, rule)
+		}
+	}
+	return unique
+}
+
+func consulPorts(manifest models.Manifest) *models.ConsulPorts {
+	properties := firstRepJob(manifest).Properties
+	if properties.Consul == nil {
+		properties = manifest.Properties
+	}
+	if properties == nil || properties.Consul == nil {
+		return nil
+	}
+	return properties.Consul.Agent.Ports
+}
+
+// dopplerPorts returns the ports dopplers listen on by protocol. The doppler
+// properties are looked up globally and on every job since they are set on
+// the doppler job rather than on the rep.
+func dopplerPorts(manifest models.Manifest) map[string]int {
+	ports := map[string]int{"udp": 3457, "tcp": 3458, "tls": 3459, "grpc": 8082}
+
+	candidates := []*models.Properties{manifest.Properties}
+	for _, job := range manifest.Jobs {
+		candidates = append(candidates, job.Properties)
+	}
+	for _, properties := range candidates {
+		if properties == nil || properties.Doppler == nil {
+			continue
+		}
+		for protocol, port := range map[string]*int{
+			"udp":  properties.Doppler.IncomingUdpPort,
+			"tcp":  properties.Doppler.IncomingTcpPort,
+			"tls":  properties.Doppler.IncomingTlsPort,
+			"grpc": properties.Doppler.GrpcPort,
+		} {
+			if port != nil {
+				ports[protocol] = *port
+			}
+		}
+		break
+	}
+	return ports
+}
+
+// repListenPort returns the port of the rep's listen address, or of its TLS
+// listen address when the rep requires TLS.
+func repListenPort(manifest models.Manifest, requireTLS bool) (int, error) {
+	name, listenAddr := "listen_addr", "0.0.0.0:1800"
+	if requireTLS {
+		name, listenAddr = "listen_addr_securable", "0.0.0.0:1801"
+	}
+
+	for _, properties := range []*models.Properties{firstRepJob(manifest).Properties, manifest.Properties} {
+		if properties == nil || properties.Diego == nil || properties.Diego.Rep == nil {
+			continue
+		}
+		addr := properties.Diego.Rep.ListenAddr
+		if requireTLS {
+			addr = properties.Diego.Rep.ListenAddrSecurable
+		}
+		if addr != "" {
+			listenAddr = addr
+			break
+		}
+	}
+
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err == nil {
+		var listenPort int
+		listenPort, err = strconv.Atoi(port)
+		if err == nil {
+			return listenPort, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid diego.rep.%s %q: %s", name, listenAddr, err)
+}
+
+// syslogServers returns the syslog server and its fallback servers as
+// transport://address:port.
+func syslogServers(args models.InstallerArguments) []string {
+	if args.SyslogHostIP == "" {
+		return nil
+	}
+
+	transport := args.SyslogTransport
+	if transport == "" {
+		transport = "udp"
+	}
+	servers := []string{transport + "://" + net.JoinHostPort(args.SyslogHostIP, args.SyslogPort)}
+	if args.SyslogFallbackServers != "" {
+		servers = append(servers, strings.Split(args.SyslogFallbackServers, ",")...)
+	}
+	return servers
+}
+
+// parseSyslogServer returns the host, transport protocol and port of a syslog
+// server given as transport://address:port. udp is the default transport
+// and 514 the default port.
+func parseSyslogServer(server string) (string, string, int, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("invalid syslog server %q: %s", server, err)
+	}
+
+	transport := "udp"
+	if u.Scheme == "tcp" || u.Scheme == "relp" {
+		transport = "tcp"
+	}
+
+	host, port := u.Host, 514
+	if h, p, err := net.SplitHostPort(u.Host); err == nil {
+		host = h
+		if p != "" {
+			port, err = strconv.Atoi(p)
+			if err != nil {
+				return "", "", 0, fmt.Errorf("invalid syslog server %q: %s", server, err)
+			}
+		}
+	}
+	return host, transport, port, nil
+}
+
+// generateFirewallScripts writes firewall.bat and remove_firewall.bat. Rule
+// names contain manifest values such as syslog hosts, so they are escaped
+// like the values of install.bat.
+func generateFirewallScripts(outputDir string, rules []firewallRule) error {
+	scripts := []installScript{
+		{"firewall.bat", firewallBatTemplate},
+		{"remove_firewall.bat", removeFirewallBatTemplate},
+	}
+
+	// render both scripts first so a name that cannot be escaped leaves
+	// neither behind
+	rendered := make([][]byte, len(scripts))
+	for i, script := range scripts {
+		content := strings.Replace(script.template, "\n", "\r\n", -1)
+		temp := template.Must(template.New("").Funcs(scriptFuncs).Parse(content))
+
+		buf := new(bytes.Buffer)
+		err := temp.Execute(buf, rules)
+		if err != nil {
+			return fmt.Errorf("%s: %s", script.filename, err)
+		}
+		rendered[i] = buf.Bytes()
+	}
+
+	for i, script := range scripts {
+		err := ioutil.WriteFile(path.Join(outputDir, script.filename), rendered[i], 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
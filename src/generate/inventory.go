@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	"models"
+)
+
+// inventoryCell is one cell of an -inventory file. Empty fields fall back to
+// the command line options.
+type inventoryCell struct {
+	Hostname              string   `yaml:"hostname"`
+	MachineIp             string   `yaml:"machine_ip"`
+	Zone                  string   `yaml:"zone"`
+	PlacementTags         []string `yaml:"placement_tags"`
+	MemoryCapacityMB      string   `yaml:"memory_capacity_mb"`
+	DiskCapacityMB        string   `yaml:"disk_capacity_mb"`
+	MaxCacheSizeInBytes   string   `yaml:"max_cache_size_in_bytes"`
+	ContainerMaxCpuShares string   `yaml:"container_max_cpu_shares"`
+	ContainerInodeLimit   string   `yaml:"container_inode_limit"`
+}
+
+// readInventory reads the cells of a YAML inventory, a list of cells, or of a
+// CSV inventory whose header row names the columns after the YAML keys. In
+// CSV files placement tags are separated by semicolons.
+func readInventory(filename string) ([]inventoryCell, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var cells []inventoryCell
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		cells, err = parseCSVInventory(content)
+	case ".yml", ".yaml":
+		err = candiedyaml.NewDecoder(bytes.NewBuffer(content)).Decode(&cells)
+	default:
+		return nil, fmt.Errorf("unknown format, use a .csv, .yml or .yaml file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cells) == 0 {
+		return nil, fmt.Errorf("no cells")
+	}
+	return cells, validateInventory(cells)
+}
+
+func parseCSVInventory(content []byte) ([]inventoryCell, error) {
+	reader := csv.NewReader(bytes.NewBuffer(content))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cells []inventoryCell
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return cells, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var cell inventoryCell
+		for i, column := range header {
+			value := strings.TrimSpace(record[i])
+			switch strings.TrimSpace(column) {
+			case "hostname":
+				cell.Hostname = value
+			case "machine_ip":
+				cell.MachineIp = value
+			case "zone":
+				cell.Zone = value
+			case "placement_tags":
+				for _, tag := range strings.Split(value, ";") {
+					if tag = strings.TrimSpace(tag); tag != "" {
+						cell.PlacementTags = append(cell.PlacementTags, tag)
+					}
+				}
+			case "memory_capacity_mb":
+				cell.MemoryCapacityMB = value
+			case "disk_capacity_mb":
+				cell.DiskCapacityMB = value
+			case "max_cache_size_in_bytes":
+				cell.MaxCacheSizeInBytes = value
+			case "container_max_cpu_shares":
+				cell.ContainerMaxCpuShares = value
+			case "container_inode_limit":
+				cell.ContainerInodeLimit = value
+			default:
+				return nil, fmt.Errorf("unknown column %q", column)
+			}
+		}
+		cells = append(cells, cell)
+	}
+}
+
+// validateInventory checks that every cell has a hostname, which names its
+// bundle directory, and an IP address, and that neither is used twice.
+func validateInventory(cells []inventoryCell) error {
+	hostnames := map[string]bool{}
+	machineIps := map[string]bool{}
+	for i, cell := range cells {
+		if cell.Hostname == "" || strings.ContainsAny(cell.Hostname, `/\:`) || cell.Hostname == "." || cell.Hostname == ".." {
+			return fmt.Errorf("cell %d has an invalid hostname %q", i+1, cell.Hostname)
+		}
+		if net.ParseIP(cell.MachineIp) == nil {
+			return fmt.Errorf("cell %q has an invalid machine IP %q", cell.Hostname, cell.MachineIp)
+		}
+
+		hostname := strings.ToLower(cell.Hostname)
+		if hostnames[hostname] {
+			return fmt.Errorf("hostname %q is listed more than once", cell.Hostname)
+		}
+		hostnames[hostname] = true
+
+		machineIp := net.ParseIP(cell.MachineIp).String()
+		if machineIps[machineIp] {
+			return fmt.Errorf("machine IP %s is listed more than once", cell.MachineIp)
+		}
+		machineIps[machineIp] = true
+	}
+	return nil
+}
+
+// optionsForCell applies the settings of an inventory cell to the command line
+// options.
+func optionsForCell(options bundleOptions, cell inventoryCell) bundleOptions {
+	options.machineIp = cell.MachineIp
+	if cell.Zone != "" {
+		options.zone = cell.Zone
+	}
+	if len(cell.PlacementTags) > 0 {
+		options.placementTags = cell.PlacementTags
+	}
+	mergeExecutorProperties(&options.executorOverrides, models.ExecutorProperties{
+		MemoryCapacityMB:      cell.MemoryCapacityMB,
+		DiskCapacityMB:        cell.DiskCapacityMB,
+		MaxCacheSizeInBytes:   cell.MaxCacheSizeInBytes,
+		ContainerMaxCpuShares: cell.ContainerMaxCpuShares,
+		ContainerInodeLimit:   cell.ContainerInodeLimit,
+	})
+	return options
+}
+
+// linkSharedFiles replaces the files of dir that are identical to the file of
+// the same name in sharedDir with hard links to it, so a fleet of bundles
+// keeps a single copy of each certificate. The install scripts are always
+// specific to the cell. Files are left as copies when the file system does
+// not support hard links.
+func linkSharedFiles(dir string, sharedDir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !file.Mode().IsRegular() || file.Name() == "install.bat" || file.Name() == "install.ps1" {
+			continue
+		}
+
+		filename := path.Join(dir, file.Name())
+		sharedFilename := path.Join(sharedDir, file.Name())
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		sharedContent, err := ioutil.ReadFile(sharedFilename)
+		if err != nil || !bytes.Equal(content, sharedContent) {
+			continue
+		}
+
+		linkname := filename + ".link"
+		if os.Link(sharedFilename, linkname) != nil {
+			continue
+		}
+		err = os.Rename(linkname, filename)
+		if err != nil {
+			os.Remove(linkname)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+
+	"models"
+)
+
+// routedIp returns the local IP address used to reach peer, which is an IPv4
+// or IPv6 address or a hostname, optionally followed by a port.
+func routedIp(peer string) (net.IP, error) {
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		// no port
+		host = strings.Trim(peer, "[]")
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(host, "65530"))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// interfaceIp selects the IP address of this machine from the addresses of
+// the named interface, or of every interface when name is empty, that are
+// within cidr when it is given. Link-local addresses are ignored. Exactly
+// one address has to match so the choice does not depend on the order the
+// system lists interfaces in.
+func interfaceIp(name string, cidr string) (net.IP, error) {
+	var ipNet *net.IPNet
+	if cidr != "" {
+		var err error
+		_, ipNet, err = net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var interfaces []net.Interface
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("interface %q: %s", name, err)
+		}
+		interfaces = []net.Interface{*iface}
+	} else {
+		var err error
+		interfaces, err = net.Interfaces()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var matches []net.IP
+	for _, iface := range interfaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			ifaceNet, ok := addr.(*net.IPNet)
+			if !ok || ifaceNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if ipNet != nil && !ipNet.Contains(ifaceNet.IP) {
+				continue
+			}
+			matches = append(matches, ifaceNet.IP)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no address matches")
+	case 1:
+		return matches[0], nil
+	}
+
+	var candidates []string
+	for _, ip := range matches {
+		candidates = append(candidates, ip.String())
+	}
+	return nil, fmt.Errorf("more than one address matches (%s), use -machineCIDR to choose one", strings.Join(candidates, ", "))
+}
+
+// repNetwork returns the network the machine IP is validated against: the
+// network named by the operator or, by default, the first network of the rep
+// job.
+func repNetwork(manifest models.Manifest, networkName string) (*models.Network, error) {
+	if networkName == "" {
+		repJob := firstRepJob(manifest)
+		if len(repJob.Networks) == 0 {
+			return nil, nil
+		}
+		networkName = repJob.Networks[0].Name
+	}
+
+	for i := range manifest.Networks {
+		if manifest.Networks[i].Name == networkName {
+			return &manifest.Networks[i], nil
+		}
+	}
+	return nil, fmt.Errorf("network %q does not exist in your BOSH deployment", networkName)
+}
+
+// validateMachineIp checks that ip belongs to one of the network's subnets
+// and does not collide with its gateway, its reserved ranges, the static IPs
+// BOSH already assigned to jobs or the rest of its static pool. Networks
+// without subnet ranges, e.g. dynamic networks, cannot be validated and are
+// accepted.
+func validateMachineIp(manifest models.Manifest, network models.Network, ip net.IP) error {
+	var subnet *models.Subnet
+	validated := false
+	for i := range network.Subnets {
+		if network.Subnets[i].Range == "" {
+			continue
+		}
+		validated = true
+
+		_, ipNet, err := net.ParseCIDR(network.Subnets[i].Range)
+		if err != nil {
+			return fmt.Errorf("invalid range %q in network %q: %s", network.Subnets[i].Range, network.Name, err)
+		}
+		if ipNet.Contains(ip) {
+			subnet = &network.Subnets[i]
+			break
+		}
+	}
+	if !validated {
+		return nil
+	}
+	if subnet == nil {
+		return fmt.Errorf("%s is not in any subnet of network %q", ip, network.Name)
+	}
+
+	if gateway := net.ParseIP(subnet.Gateway); gateway != nil && gateway.Equal(ip) {
+		return fmt.Errorf("%s is the gateway of network %q", ip, network.Name)
+	}
+
+	for _, reserved := range subnet.Reserved {
+		inRange, err := ipInRange(ip, reserved)
+		if err != nil {
+			return fmt.Errorf("invalid reserved range %q in network %q: %s", reserved, network.Name, err)
+		}
+		if inRange {
+			return fmt.Errorf("%s is reserved in network %q (%s)", ip, network.Name, reserved)
+		}
+	}
+
+	for _, job := range manifest.Jobs {
+		for _, jobNetwork := range job.Networks {
+			if jobNetwork.Name != network.Name {
+				continue
+			}
+			for _, staticIp := range jobNetwork.StaticIPs {
+				if net.ParseIP(staticIp).Equal(ip) {
+					return fmt.Errorf("%s is already assigned to job %q in network %q", ip, job.Name, network.Name)
+				}
+			}
+		}
+	}
+
+	// BOSH hands out the rest of the static pool to jobs later on
+	for _, static := range subnet.Static {
+		inRange, err := ipInRange(ip, static)
+		if err != nil {
+			return fmt.Errorf("invalid static range %q in network %q: %s", static, network.Name, err)
+		}
+		if inRange {
+			return fmt.Errorf("%s is in the static IP pool of network %q (%s)", ip, network.Name, static)
+		}
+	}
+
+	return nil
+}
+
+// ipInRange reports whether ip is within a BOSH IP range, which is a single
+// IP, two IPs separated by a dash ("10.0.0.2 - 10.0.0.10") or a CIDR block.
+func ipInRange(ip net.IP, ipRange string) (bool, error) {
+	if strings.Contains(ipRange, "/") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(ipRange))
+		if err != nil {
+			return false, err
+		}
+		return ipNet.Contains(ip), nil
+	}
+
+	bounds := strings.SplitN(ipRange, "-", 2)
+	first := net.ParseIP(strings.TrimSpace(bounds[0]))
+	last := first
+	if len(bounds) == 2 {
+		last = net.ParseIP(strings.TrimSpace(bounds[1]))
+	}
+	if first == nil || last == nil {
+		return false, fmt.Errorf("not an IP or a range of IPs")
+	}
+
+	return bytes.Compare(ip.To16(), first.To16()) >= 0 && bytes.Compare(ip.To16(), last.To16()) <= 0, nil
+}
@@ -15,19 +15,54 @@ type ShowDeployment struct {
 }
 
 type InstallerArguments struct {
-	ConsulRequireSSL bool
-	ConsulIPs        string
-	EtcdCluster      string
-	Zone             string
-	SharedSecret     string
-	Username         string
-	Password         string
-	SyslogHostIP     string
-	SyslogPort       string
-	BbsRequireSsl    bool
-	MachineIp        string
-	MetronPreferTLS  bool
-	ConsulDomain     string
+	ConsulRequireSSL      bool
+	ConsulKeyring         bool
+	ConsulConfig          bool
+	ConsulIPs             string
+	EtcdCluster           string
+	EtcdRequireSSL        bool
+	Zone                  string
+	SharedSecret          string
+	Username              string
+	Password              string
+	SyslogHostIP          string
+	SyslogPort            string
+	SyslogTransport       string
+	SyslogFallbackServers string
+	SyslogTLS             bool
+	SyslogCA              bool
+	SyslogPermittedPeer   string
+	BbsRequireSsl         bool
+	RepRequireTLS         bool
+	TrustedCertFiles      []string
+	PlacementTags         string
+	OptionalPlacementTags string
+	MemoryCapacityMB      string
+	DiskCapacityMB        string
+	MaxCacheSizeInBytes   string
+	ContainerMaxCpuShares string
+	ContainerInodeLimit   string
+	MachineIp             string
+	MetronPreferTLS       bool
+	MetronProtocols       string
+	MetronEndpointHost    string
+	MetronDropsondePort   string
+	MetronDeployment      string
+	MetronJob             string
+	MetronIndex           int
+	LoggregatorV2         bool
+	MetronGrpcPort        int
+	ConsulDomain          string
+	Stack                 string
+	BoshDNS               bool
+	BoshDNSServers        string
+	BbsAddress            string
+	LocketAddress         string
+	HttpProxy             string
+	HttpsProxy            string
+	NoProxy               string
+	DomainUser            bool
+	ManagedServiceAccount bool
 }
 
 type ConsulProperties struct {
@@ -37,73 +72,209 @@ type ConsulProperties struct {
 	AgentKey    string   `yaml:"agent_key"`
 	EncryptKeys []string `yaml:"encrypt_keys"`
 	Agent       struct {
-		Domain  string
-		Servers struct {
+		Domain     string
+		Datacenter string           `yaml:"datacenter"`
+		LogLevel   string           `yaml:"log_level"`
+		Ports      *ConsulPorts     `yaml:"ports"`
+		DnsConfig  *ConsulDnsConfig `yaml:"dns_config"`
+		Servers    struct {
 			Lan []string `yaml:"lan"`
 		} `yaml:"servers"`
 	} `yaml:"agent"`
 }
 
+type ConsulPorts struct {
+	DNS     *int `yaml:"dns" json:"dns,omitempty"`
+	HTTP    *int `yaml:"http" json:"http,omitempty"`
+	HTTPS   *int `yaml:"https" json:"https,omitempty"`
+	RPC     *int `yaml:"rpc" json:"rpc,omitempty"`
+	SerfLan *int `yaml:"serf_lan" json:"serf_lan,omitempty"`
+	SerfWan *int `yaml:"serf_wan" json:"serf_wan,omitempty"`
+	Server  *int `yaml:"server" json:"server,omitempty"`
+}
+
+type ConsulDnsConfig struct {
+	AllowStale      *bool             `yaml:"allow_stale" json:"allow_stale,omitempty"`
+	MaxStale        string            `yaml:"max_stale" json:"max_stale,omitempty"`
+	NodeTTL         string            `yaml:"node_ttl" json:"node_ttl,omitempty"`
+	ServiceTTL      map[string]string `yaml:"service_ttl" json:"service_ttl,omitempty"`
+	RecursorTimeout string            `yaml:"recursor_timeout" json:"recursor_timeout,omitempty"`
+	EnableTruncate  *bool             `yaml:"enable_truncate" json:"enable_truncate,omitempty"`
+	OnlyPassing     *bool             `yaml:"only_passing" json:"only_passing,omitempty"`
+}
+
+// ConsulAgentConfig is the subset of the Consul agent JSON configuration that
+// is not covered by the DiegoWindows.msi parameters.
+type ConsulAgentConfig struct {
+	Datacenter string           `json:"datacenter,omitempty"`
+	LogLevel   string           `json:"log_level,omitempty"`
+	Ports      *ConsulPorts     `json:"ports,omitempty"`
+	DnsConfig  *ConsulDnsConfig `json:"dns_config,omitempty"`
+}
+
 type BBSProperties struct {
-	CACert     string `yaml:"ca_cert"`
-	ClientCert string `yaml:"client_cert"`
-	ClientKey  string `yaml:"client_key"`
-	RequireSSL *bool  `yaml:"require_ssl"`
+	APILocation string `yaml:"api_location"`
+	CACert      string `yaml:"ca_cert"`
+	ClientCert  string `yaml:"client_cert"`
+	ClientKey   string `yaml:"client_key"`
+	RequireSSL  *bool  `yaml:"require_ssl"`
 }
 
 type DiegoProperties struct {
 	Rep *struct {
-		Zone string         `yaml:"zone"`
-		BBS  *BBSProperties `yaml:"bbs"`
+		Zone                  string         `yaml:"zone"`
+		BBS                   *BBSProperties `yaml:"bbs"`
+		CACert                string         `yaml:"ca_cert"`
+		ServerCert            string         `yaml:"server_cert"`
+		ServerKey             string         `yaml:"server_key"`
+		RequireTLS            *bool          `yaml:"require_tls"`
+		TrustedCerts          string         `yaml:"trusted_certs"`
+		PlacementTags         []string       `yaml:"placement_tags"`
+		OptionalPlacementTags []string       `yaml:"optional_placement_tags"`
+		ListenAddr            string         `yaml:"listen_addr"`
+		ListenAddrSecurable   string         `yaml:"listen_addr_securable"`
 	} `yaml:"rep"`
+	Executor *ExecutorProperties `yaml:"executor"`
+}
+
+type ExecutorProperties struct {
+	MemoryCapacityMB      string `yaml:"memory_capacity_mb"`
+	DiskCapacityMB        string `yaml:"disk_capacity_mb"`
+	MaxCacheSizeInBytes   string `yaml:"max_cache_size_in_bytes"`
+	ContainerMaxCpuShares string `yaml:"container_max_cpu_shares"`
+	ContainerInodeLimit   string `yaml:"container_inode_limit"`
 }
 
 type LoggregatorProperties struct {
 	Etcd struct {
-		Machines []string `yaml:"machines"`
+		Machines   []string `yaml:"machines"`
+		RequireSSL *bool    `yaml:"require_ssl"`
+		Port       *int     `yaml:"port"`
+		CACert     string   `yaml:"ca_cert"`
 	} `yaml:"etcd"`
 	Tls struct {
-		CA string `yaml:"ca"`
+		CA     string `yaml:"ca"`
 		CACert string `yaml:"ca_cert"`
+		Agent  struct {
+			Cert string `yaml:"cert"`
+			Key  string `yaml:"key"`
+		} `yaml:"agent"`
 	} `yaml:"tls"`
+	UseV2API *bool `yaml:"use_v2_api"`
 }
 
 type MetronEndpoint struct {
-	SharedSecret string `yaml:"shared_secret"`
+	SharedSecret  string `yaml:"shared_secret"`
+	Host          string `yaml:"host"`
+	DropsondePort string `yaml:"dropsonde_port"`
 }
 
 type MetronAgent struct {
-	PreferredProtocol *string `yaml:"preferred_protocol"`
-	Tls struct {
+	PreferredProtocol *string  `yaml:"preferred_protocol"`
+	Protocols         []string `yaml:"protocols"`
+	Deployment        string   `yaml:"deployment"`
+	GrpcPort          *int     `yaml:"grpc_port"`
+	Tls               struct {
 		ClientCert string `yaml:"client_cert"`
 		ClientKey  string `yaml:"client_key"`
 	} `yaml:"tls"`
-	TlsClient         struct {
+	TlsClient struct {
 		Cert string `yaml:"cert"`
 		Key  string `yaml:"key"`
 	} `yaml:"tls_client"`
+	Etcd struct {
+		ClientCert string `yaml:"client_cert"`
+		ClientKey  string `yaml:"client_key"`
+	} `yaml:"etcd"`
+}
+
+type DopplerProperties struct {
+	IncomingUdpPort *int `yaml:"incoming_udp_port"`
+	IncomingTcpPort *int `yaml:"incoming_tcp_port"`
+	IncomingTlsPort *int `yaml:"incoming_tls_port"`
+	GrpcPort        *int `yaml:"grpc_port"`
+}
+
+// EnvProperties are the proxy settings BOSH jobs read from env.
+type EnvProperties struct {
+	HttpProxy  string `yaml:"http_proxy"`
+	HttpsProxy string `yaml:"https_proxy"`
+	NoProxy    string `yaml:"no_proxy"`
+}
+
+type CCProperties struct {
+	Stacks []struct {
+		Name string `yaml:"name"`
+	} `yaml:"stacks"`
+}
+
+type LocketProperties struct {
+	APILocation string `yaml:"api_location"`
+}
+
+type RootfsProperties struct {
+	TrustedCerts string `yaml:"trusted_certs"`
 }
 
+// SyslogProperties covers both the cf-release syslog_daemon_config and the
+// syslog_forwarder release's syslog properties.
 type SyslogProperties struct {
-	Address string `yaml:"address"`
-	Port    string `yaml:"port"`
+	Address         string         `yaml:"address"`
+	Port            string         `yaml:"port"`
+	Transport       string         `yaml:"transport"`
+	FallbackServers []SyslogServer `yaml:"fallback_servers"`
+	TLSEnabled      *bool          `yaml:"tls_enabled"`
+	CACert          string         `yaml:"ca_cert"`
+	PermittedPeer   string         `yaml:"permitted_peer"`
+}
+
+type SyslogServer struct {
+	Address   string `yaml:"address"`
+	Port      string `yaml:"port"`
+	Transport string `yaml:"transport"`
 }
 
 type Properties struct {
-	Consul         *ConsulProperties      `yaml:"consul"`
-	Diego          *DiegoProperties       `yaml:"diego"`
-	Loggregator    *LoggregatorProperties `yaml:"loggregator"`
-	MetronEndpoint *MetronEndpoint        `yaml:"metron_endpoint"`
-	MetronAgent    *MetronAgent           `yaml:"metron_agent"`
-	Syslog         *SyslogProperties      `yaml:"syslog_daemon_config"`
+	Consul          *ConsulProperties      `yaml:"consul"`
+	Diego           *DiegoProperties       `yaml:"diego"`
+	Loggregator     *LoggregatorProperties `yaml:"loggregator"`
+	MetronEndpoint  *MetronEndpoint        `yaml:"metron_endpoint"`
+	MetronAgent     *MetronAgent           `yaml:"metron_agent"`
+	Syslog          *SyslogProperties      `yaml:"syslog_daemon_config"`
+	SyslogForwarder *SyslogProperties      `yaml:"syslog"`
+	Rootfs          *RootfsProperties      `yaml:"cflinuxfs2-rootfs"`
+	Locket          *LocketProperties      `yaml:"locket"`
+	CC              *CCProperties          `yaml:"cc"`
+	Doppler         *DopplerProperties     `yaml:"doppler"`
+	Env             *EnvProperties         `yaml:"env"`
+}
+
+type JobNetwork struct {
+	Name      string   `yaml:"name"`
+	StaticIPs []string `yaml:"static_ips"`
 }
 
 type Job struct {
-	Name       string      `yaml:"name"`
-	Properties *Properties `yaml:"properties"`
+	Name       string       `yaml:"name"`
+	Properties *Properties  `yaml:"properties"`
+	Networks   []JobNetwork `yaml:"networks"`
+}
+
+type Subnet struct {
+	Range    string   `yaml:"range"`
+	Gateway  string   `yaml:"gateway"`
+	DNS      []string `yaml:"dns"`
+	Reserved []string `yaml:"reserved"`
+	Static   []string `yaml:"static"`
+}
+
+type Network struct {
+	Name    string   `yaml:"name"`
+	Subnets []Subnet `yaml:"subnets"`
 }
 
 type Manifest struct {
 	Jobs       []Job       `yaml:"jobs"`
 	Properties *Properties `yaml:"properties"`
+	Networks   []Network   `yaml:"networks"`
 }